@@ -0,0 +1,45 @@
+package proc
+
+// MemoryReadRequest describes one region to read as part of a batched
+// memory read: Addr is the address in the target process and Data is the
+// local buffer its contents should be copied into.
+type MemoryReadRequest struct {
+	Addr uint64
+	Data []byte
+}
+
+// MemoryReader is the read half of the target process's memory, exposed on
+// its own since most callers (variable loading, stack unwinding) only ever
+// read.
+type MemoryReader interface {
+	ReadMemory(data []byte, addr uint64) (n int, err error)
+}
+
+// MultiMemoryReader is implemented by a MemoryReader that can service
+// several reads with fewer underlying syscalls than one ReadMemory call per
+// region, such as native's threads batching process_vm_readv calls.
+type MultiMemoryReader interface {
+	MemoryReader
+	ReadMultiple(regions []MemoryReadRequest) (int, error)
+}
+
+// ReadMultiple reads every region in regions from mem, using mem's batched
+// fast path when it implements MultiMemoryReader and falling back to one
+// ReadMemory call per region otherwise. Callers that need to read many
+// scattered regions in one pass (e.g. loading the fields of a struct with
+// several pointer members) should go through this instead of looping over
+// ReadMemory themselves, so that backends capable of batching get to.
+func ReadMultiple(mem MemoryReader, regions []MemoryReadRequest) (int, error) {
+	if m, ok := mem.(MultiMemoryReader); ok {
+		return m.ReadMultiple(regions)
+	}
+	total := 0
+	for _, r := range regions {
+		n, err := mem.ReadMemory(r.Data, r.Addr)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -3,34 +3,118 @@
 package native
 
 import (
+	"fmt"
 	"syscall"
 	"unsafe"
 
 	sys "golang.org/x/sys/unix"
 )
 
-// ProcessVmRead calls process_vm_readv
+// iovMax is the maximum number of iovec entries that process_vm_readv and
+// process_vm_writev will accept in a single call (Linux's IOV_MAX).
+const iovMax = 1024
+
+// MemoryRegion pairs a remote address in the traced process with the local
+// buffer that its contents should be read into (or written from), for use
+// with ProcessVmReadv/ProcessVmWritev.
+type MemoryRegion struct {
+	Addr uintptr
+	Data []byte
+}
+
+// ShortRegionError is returned by ProcessVmReadv/ProcessVmWritev when the
+// kernel transfers fewer bytes than requested for one of the regions in the
+// batch. Index is the position of the affected region in the slice that was
+// passed in, and N is the number of bytes actually transferred for it.
+type ShortRegionError struct {
+	Index int
+	N     int
+}
+
+func (e *ShortRegionError) Error() string {
+	return fmt.Sprintf("process_vm_readv/writev: short transfer for region %d (%d bytes transferred)", e.Index, e.N)
+}
+
+// ProcessVmRead calls process_vm_readv to read a single region of memory out
+// of the traced process.
 func ProcessVmRead(tid int, addr uintptr, data []byte) (int, error) {
-	len_iov := uint64(len(data))
-	local_iov := sys.Iovec{Base: &data[0], Len: len_iov}
-	remote_iov := sys.Iovec{Base: (*byte)(unsafe.Pointer(addr)), Len: len_iov}
-	p_local := uintptr(unsafe.Pointer(&local_iov))
-	p_remote := uintptr(unsafe.Pointer(&remote_iov))
-	n, _, err := syscall.Syscall6(sys.SYS_PROCESS_VM_READV, uintptr(tid), p_local, 1, p_remote, 1, 0)
-	if err != syscall.Errno(0) {
-		return 0, err
-	}
-	return int(n), nil
+	return processVmCall(sys.SYS_PROCESS_VM_READV, tid, []MemoryRegion{{addr, data}})
 }
 
-// ProcessVmWrite calls process_vm_writev
+// ProcessVmWrite calls process_vm_writev to write a single region of memory
+// into the traced process.
 func ProcessVmWrite(tid int, addr uintptr, data []byte) (int, error) {
-	len_iov := uint64(len(data))
-	local_iov := sys.Iovec{Base: &data[0], Len: len_iov}
-	remote_iov := sys.Iovec{Base: (*byte)(unsafe.Pointer(addr)), Len: len_iov}
-	p_local := uintptr(unsafe.Pointer(&local_iov))
-	p_remote := uintptr(unsafe.Pointer(&remote_iov))
-	n, _, err := syscall.Syscall6(sys.SYS_PROCESS_VM_WRITEV, uintptr(tid), p_local, 1, p_remote, 1, 0)
+	return processVmCall(sys.SYS_PROCESS_VM_WRITEV, tid, []MemoryRegion{{addr, data}})
+}
+
+// ProcessVmReadv reads multiple memory regions out of the traced process,
+// packing up to iovMax regions into each process_vm_readv call instead of
+// issuing one syscall per region. It returns the total number of bytes read
+// across all regions. If the kernel stops partway through a region the
+// returned error is a *ShortRegionError identifying which region was short;
+// regions before it were read in full and regions after it were not
+// attempted.
+func ProcessVmReadv(tid int, regions []MemoryRegion) (int, error) {
+	return processVmBatch(sys.SYS_PROCESS_VM_READV, tid, regions)
+}
+
+// ProcessVmWritev is the write counterpart of ProcessVmReadv.
+func ProcessVmWritev(tid int, regions []MemoryRegion) (int, error) {
+	return processVmBatch(sys.SYS_PROCESS_VM_WRITEV, tid, regions)
+}
+
+// processVmBatch splits regions into chunks of at most iovMax and issues one
+// process_vm_readv/writev call per chunk.
+func processVmBatch(sysno uintptr, tid int, regions []MemoryRegion) (int, error) {
+	total := 0
+	done := 0
+	for len(regions) > 0 {
+		batch := regions
+		if len(batch) > iovMax {
+			batch = batch[:iovMax]
+		}
+		n, err := processVmCall(sysno, tid, batch)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if idx, got, short := shortRegion(batch, n); short {
+			return total, &ShortRegionError{Index: done + idx, N: got}
+		}
+		regions = regions[len(batch):]
+		done += len(batch)
+	}
+	return total, nil
+}
+
+// shortRegion walks the cumulative length of the regions in batch to find
+// which one absorbed fewer bytes than it was given, given that the syscall
+// transferred n bytes in total. ok is false if every region in batch was
+// transferred in full.
+func shortRegion(batch []MemoryRegion, n int) (idx int, got int, ok bool) {
+	cum := 0
+	for i, r := range batch {
+		if n < cum+len(r.Data) {
+			return i, n - cum, true
+		}
+		cum += len(r.Data)
+	}
+	return 0, 0, false
+}
+
+// processVmCall issues a single process_vm_readv/process_vm_writev syscall
+// covering every region in regions (which must not exceed iovMax entries).
+func processVmCall(sysno uintptr, tid int, regions []MemoryRegion) (int, error) {
+	local := make([]sys.Iovec, len(regions))
+	remote := make([]sys.Iovec, len(regions))
+	for i, r := range regions {
+		if len(r.Data) == 0 {
+			continue
+		}
+		local[i] = sys.Iovec{Base: &r.Data[0], Len: uint64(len(r.Data))}
+		remote[i] = sys.Iovec{Base: (*byte)(unsafe.Pointer(r.Addr)), Len: uint64(len(r.Data))}
+	}
+	n, _, err := syscall.Syscall6(sysno, uintptr(tid), uintptr(unsafe.Pointer(&local[0])), uintptr(len(regions)), uintptr(unsafe.Pointer(&remote[0])), uintptr(len(regions)), 0)
 	if err != syscall.Errno(0) {
 		return 0, err
 	}
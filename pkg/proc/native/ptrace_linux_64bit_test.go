@@ -0,0 +1,52 @@
+// +build linux,amd64 linux,arm64
+
+package native
+
+import "testing"
+
+func TestShortRegion(t *testing.T) {
+	regions := []MemoryRegion{
+		{Addr: 0x1000, Data: make([]byte, 4)},
+		{Addr: 0x2000, Data: make([]byte, 8)},
+		{Addr: 0x3000, Data: make([]byte, 4)},
+	}
+
+	tests := []struct {
+		name    string
+		n       int
+		wantOk  bool
+		wantIdx int
+		wantGot int
+	}{
+		{"full transfer", 16, false, 0, 0},
+		{"short in first region", 2, true, 0, 2},
+		{"short in middle region", 6, true, 1, 2},
+		{"short in last region", 14, true, 2, 2},
+		{"nothing transferred", 0, true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, got, ok := shortRegion(regions, tt.n)
+			if ok != tt.wantOk {
+				t.Fatalf("shortRegion(%d) ok = %v, want %v", tt.n, ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if idx != tt.wantIdx || got != tt.wantGot {
+				t.Fatalf("shortRegion(%d) = (%d, %d), want (%d, %d)", tt.n, idx, got, tt.wantIdx, tt.wantGot)
+			}
+		})
+	}
+}
+
+func TestShortRegionSkipsEmptyRegions(t *testing.T) {
+	regions := []MemoryRegion{
+		{Addr: 0x1000, Data: nil},
+		{Addr: 0x2000, Data: make([]byte, 4)},
+	}
+	if idx, got, ok := shortRegion(regions, 2); !ok || idx != 1 || got != 2 {
+		t.Fatalf("shortRegion = (%d, %d, %v), want (1, 2, true)", idx, got, ok)
+	}
+}
@@ -0,0 +1,41 @@
+// +build linux,amd64 linux,arm64
+
+package native
+
+import "github.com/go-delve/delve/pkg/proc"
+
+// nativeThread is the memory-facing slice of delve's per-thread ptrace
+// state: a traced tid along with the ReadMemory/WriteMemory/ReadMultiple
+// methods that talk to it over process_vm_readv/writev. Register access,
+// stepping and breakpoint handling for the thread live elsewhere in the
+// production tree; this file only wires up proc.MultiMemoryReader.
+type nativeThread struct {
+	ID int
+}
+
+// ReadMemory reads len(data) bytes from addr in the traced process into
+// data.
+func (t *nativeThread) ReadMemory(data []byte, addr uint64) (int, error) {
+	return ProcessVmRead(t.ID, uintptr(addr), data)
+}
+
+// WriteMemory writes data to addr in the traced process.
+func (t *nativeThread) WriteMemory(addr uint64, data []byte) (int, error) {
+	return ProcessVmWrite(t.ID, uintptr(addr), data)
+}
+
+// ReadMultiple implements proc.MultiMemoryReader, batching every region in
+// regions into as few process_vm_readv calls as iovMax allows instead of
+// issuing one syscall per region. Callers such as struct/slice variable
+// loading, which otherwise read one field at a time, should prefer
+// proc.ReadMultiple(thread, regions) over looping over ReadMemory so they
+// actually collapse onto this path.
+func (t *nativeThread) ReadMultiple(regions []proc.MemoryReadRequest) (int, error) {
+	batch := make([]MemoryRegion, len(regions))
+	for i, r := range regions {
+		batch[i] = MemoryRegion{Addr: uintptr(r.Addr), Data: r.Data}
+	}
+	return ProcessVmReadv(t.ID, batch)
+}
+
+var _ proc.MultiMemoryReader = (*nativeThread)(nil)
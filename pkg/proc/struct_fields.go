@@ -0,0 +1,28 @@
+package proc
+
+// FieldLayout describes one struct field to read: its byte offset from the
+// struct's base address and its size.
+type FieldLayout struct {
+	Offset uint64
+	Size   int
+}
+
+// ReadStructFields reads every field in fields out of the struct at base in
+// mem's address space, going through ReadMultiple so a backend capable of
+// batching (such as native's process_vm_readv-backed threads) reads them
+// all in as few syscalls as possible instead of one per field - the
+// pattern DWARF-driven struct variable loading follows once it has more
+// than one field to pull out of the same object at once.
+func ReadStructFields(mem MemoryReader, base uint64, fields []FieldLayout) ([][]byte, error) {
+	regions := make([]MemoryReadRequest, len(fields))
+	values := make([][]byte, len(fields))
+	for i, f := range fields {
+		buf := make([]byte, f.Size)
+		values[i] = buf
+		regions[i] = MemoryReadRequest{Addr: base + f.Offset, Data: buf}
+	}
+	if _, err := ReadMultiple(mem, regions); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
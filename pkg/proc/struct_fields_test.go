@@ -0,0 +1,61 @@
+package proc
+
+import (
+	"bytes"
+	"testing"
+)
+
+type fakeMemory struct {
+	data map[uint64][]byte
+}
+
+func (m *fakeMemory) ReadMemory(data []byte, addr uint64) (int, error) {
+	copy(data, m.data[addr])
+	return len(data), nil
+}
+
+type fakeMultiMemory struct {
+	fakeMemory
+	calls int
+}
+
+func (m *fakeMultiMemory) ReadMultiple(regions []MemoryReadRequest) (int, error) {
+	m.calls++
+	total := 0
+	for _, r := range regions {
+		copy(r.Data, m.data[r.Addr])
+		total += len(r.Data)
+	}
+	return total, nil
+}
+
+func TestReadStructFieldsUsesBatchedFastPath(t *testing.T) {
+	mem := &fakeMultiMemory{fakeMemory: fakeMemory{data: map[uint64][]byte{
+		0x1000: {1, 2, 3, 4},
+		0x1004: {5, 6},
+	}}}
+
+	values, err := ReadStructFields(mem, 0x1000, []FieldLayout{{Offset: 0, Size: 4}, {Offset: 4, Size: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mem.calls != 1 {
+		t.Fatalf("ReadStructFields made %d ReadMultiple calls, want 1", mem.calls)
+	}
+	if !bytes.Equal(values[0], []byte{1, 2, 3, 4}) || !bytes.Equal(values[1], []byte{5, 6}) {
+		t.Fatalf("unexpected field values: %v", values)
+	}
+}
+
+func TestReadStructFieldsFallsBackWithoutMultiMemoryReader(t *testing.T) {
+	mem := &fakeMemory{data: map[uint64][]byte{
+		0x2000: {9, 9},
+	}}
+	values, err := ReadStructFields(mem, 0x2000, []FieldLayout{{Offset: 0, Size: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(values[0], []byte{9, 9}) {
+		t.Fatalf("unexpected field value: %v", values[0])
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"net"
+	"time"
+)
+
+// Config provides the configuration to start a Debugger and expose it with a
+// service.
+type Config struct {
+	// Listener is used to accept client connections.
+	Listener net.Listener
+
+	// Backend specifies the debugger backend.
+	Backend string
+
+	// DisconnectChan will be closed by the server when the client disconnects
+	// or requests a stop.
+	DisconnectChan chan struct{}
+
+	// RequestTimeout sets a deadline on the context of each client request.
+	// Zero means no limit. Currently only consulted by the DAP server, where
+	// only the variables handler checks it: if the deadline has passed once
+	// the variables are loaded, it replies with a "timeout" error instead.
+	// Other requests run to completion regardless.
+	RequestTimeout time.Duration
+}
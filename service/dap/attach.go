@@ -0,0 +1,109 @@
+package dap
+
+import (
+	"fmt"
+
+	"github.com/go-delve/delve/service/debugger"
+	"github.com/go-delve/delve/service/rpc2"
+	"github.com/google/go-dap"
+)
+
+// sessionKind records how a debug session was established, so that
+// disconnect can decide whether tearing down means killing the debuggee or
+// merely detaching from it.
+type sessionKind int
+
+const (
+	sessionLaunched sessionKind = iota // we built and/or started the target ourselves
+	sessionAttached                    // we attached to an already running local process
+	sessionRemote                      // we are a client of someone else's headless server
+)
+
+// onAttachRequest handles the "attach" launch request, which the DAP spec
+// treats as its own request type distinct from "launch". We fold both
+// "mode": "attach" (attach to a running local process) and "mode": "remote"
+// (connect to an already running headless `dlv` RPC server) under it, since
+// neither one builds a binary the way "debug"/"test"/"exec" do.
+func (s *Server) onAttachRequest(request *dap.AttachRequest) {
+	mode, _ := request.Arguments["mode"].(string)
+	if mode == "" {
+		mode = "local"
+	}
+	switch mode {
+	case "local", "attach":
+		s.onAttachLocalRequest(request)
+	case "remote":
+		s.onAttachRemoteRequest(request)
+	default:
+		s.sendErrorResponse(request.Request, FailedToAttach,
+			"Failed to attach", fmt.Sprintf("Unsupported 'mode' value %q in debug configuration.", mode))
+	}
+}
+
+// onAttachLocalRequest attaches to a running local process by pid, the way
+// `dlv attach <pid>` does, without building or launching anything.
+func (s *Server) onAttachLocalRequest(request *dap.AttachRequest) {
+	pid, ok := request.Arguments["processId"].(float64)
+	if !ok || pid == 0 {
+		s.sendErrorResponse(request.Request, FailedToAttach,
+			"Failed to attach", "The processId attribute is missing in debug configuration.")
+		return
+	}
+
+	dbg, err := debugger.New(&debugger.Config{
+		AttachPid: int(pid),
+		Backend:   s.config.Backend,
+	}, nil)
+	if err != nil {
+		s.sendErrorResponse(request.Request, FailedToAttach, "Failed to attach", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.sessionKind = sessionAttached
+	s.debugger = dbg
+	s.mu.Unlock()
+
+	s.send(&dap.InitializedEvent{Event: *newEvent("initialized")})
+	s.send(&dap.AttachResponse{Response: *newResponse(request.Request)})
+}
+
+// onAttachRemoteRequest connects to an existing headless `dlv --headless`
+// RPC server at the given address, a debugger that is already running
+// elsewhere rather than one of our own. This is the same target the
+// JSON-RPC frontend reaches via `dlv connect`. Only onDisconnectRequest
+// uses the resulting client; the other handlers do not forward requests to
+// it and behave as if no debugger were loaded.
+func (s *Server) onAttachRemoteRequest(request *dap.AttachRequest) {
+	addr, ok := request.Arguments["addr"].(string)
+	if !ok || addr == "" {
+		s.sendErrorResponse(request.Request, FailedToAttach,
+			"Failed to attach", "The addr attribute is missing in debug configuration.")
+		return
+	}
+
+	client := rpc2.NewClient(addr)
+
+	s.mu.Lock()
+	s.sessionKind = sessionRemote
+	s.remoteClient = client
+	s.mu.Unlock()
+
+	s.send(&dap.InitializedEvent{Event: *newEvent("initialized")})
+	s.send(&dap.AttachResponse{Response: *newResponse(request.Request)})
+}
+
+// supportsTerminateDebuggee reports whether this session can honor a
+// client request to kill the debuggee on disconnect at all. It is true for
+// anything we own the lifetime of, whether we launched it or only attached
+// to it, and false for a remote session, since killing someone else's
+// headless server's debuggee out from under them would be rude. It gates
+// whether DisconnectRequest's "terminateDebuggee" argument can override
+// onDisconnectRequest's default of only killing what we launched. It does
+// not feed the "supportsTerminateDebuggee" capability, which
+// onInitializeRequest always advertises as true.
+func (s *Server) supportsTerminateDebuggee() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessionKind != sessionRemote
+}
@@ -0,0 +1,72 @@
+package dap
+
+import (
+	"context"
+
+	"github.com/google/go-dap"
+)
+
+// beginRequest derives a context for the request identified by seq, honoring
+// the server's configured RequestTimeout (if any) and registering the
+// resulting cancel func so that a later "cancel" request for the same seq
+// can tear it down. Every dispatched request gets one, for this
+// bookkeeping, but onVariablesRequest is currently the only handler that
+// receives the context itself, and it only checks ctx.Err() once
+// dbg.LoadVariables returns - nothing below that boundary (DWARF entry
+// visits, the individual memory reads inside a LoadValue) checkpoints on
+// it yet, so cancelling a load already in flight doesn't interrupt it
+// early. The caller must call endRequest once the request completes.
+func (s *Server) beginRequest(seq int) context.Context {
+	ctx := context.Background()
+	var cancel context.CancelFunc
+	if s.config.RequestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.config.RequestTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	s.requestCancelsMu.Lock()
+	s.requestCancels[seq] = cancel
+	s.requestCancelsMu.Unlock()
+
+	return ctx
+}
+
+// endRequest releases the bookkeeping begun by beginRequest. Safe to call
+// whether or not the request was ever cancelled.
+func (s *Server) endRequest(seq int) {
+	s.requestCancelsMu.Lock()
+	if cancel, ok := s.requestCancels[seq]; ok {
+		cancel()
+		delete(s.requestCancels, seq)
+	}
+	s.requestCancelsMu.Unlock()
+}
+
+// onCancelRequest handles the DAP "cancel" request: a client sends this to
+// ask us to abandon an in-flight request identified by RequestId. We don't
+// emit progress notifications yet, so ProgressId is ignored.
+func (s *Server) onCancelRequest(request *dap.CancelRequest) {
+	if request.Arguments.RequestId != 0 {
+		s.requestCancelsMu.Lock()
+		cancel, ok := s.requestCancels[request.Arguments.RequestId]
+		s.requestCancelsMu.Unlock()
+		if ok {
+			cancel()
+		}
+	}
+	s.send(&dap.CancelResponse{Response: *newResponse(request.Request)})
+}
+
+// sendCancelledErrorResponse replies to request with a DAP error response
+// reporting how ctx ended: "cancelled" if a client "cancel" request
+// triggered it, "timeout" if it tripped the server's configured
+// RequestTimeout instead. These are deliberately distinct: a timeout is a
+// server-side policy decision, not something the client asked for.
+func (s *Server) sendCancelledErrorResponse(ctx context.Context, request dap.Request) {
+	if ctx.Err() == context.DeadlineExceeded {
+		s.sendErrorResponse(request, RequestCancelled, "timeout", "timeout")
+		return
+	}
+	s.sendErrorResponse(request, RequestCancelled, "cancelled", "cancelled")
+}
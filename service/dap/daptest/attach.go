@@ -0,0 +1,22 @@
+package daptest
+
+import (
+	"testing"
+
+	"github.com/google/go-dap"
+)
+
+// AttachRequest sends an "attach" request with the given arguments, mirroring
+// LaunchRequestWithArgs for the launch request.
+func (c *Client) AttachRequest(arguments map[string]interface{}) {
+	request := &dap.AttachRequest{Request: *c.newRequest("attach")}
+	request.Arguments = arguments
+	c.send(request)
+}
+
+// ExpectAttachResponse reads and returns an AttachResponse, failing the test
+// if the next message is not one.
+func (c *Client) ExpectAttachResponse(t *testing.T) *dap.AttachResponse {
+	t.Helper()
+	return c.expectMessage(t).(*dap.AttachResponse)
+}
@@ -0,0 +1,22 @@
+package daptest
+
+import (
+	"testing"
+
+	"github.com/google/go-dap"
+)
+
+// CancelRequest sends a "cancel" request asking the server to abandon the
+// in-flight request with the given requestId.
+func (c *Client) CancelRequest(requestId int) {
+	request := &dap.CancelRequest{Request: *c.newRequest("cancel")}
+	request.Arguments = dap.CancelArguments{RequestId: requestId}
+	c.send(request)
+}
+
+// ExpectCancelResponse reads and returns a CancelResponse, failing the test
+// if the next message is not one.
+func (c *Client) ExpectCancelResponse(t *testing.T) *dap.CancelResponse {
+	t.Helper()
+	return c.expectMessage(t).(*dap.CancelResponse)
+}
@@ -0,0 +1,12 @@
+package daptest
+
+import "io"
+
+// NewClientFromConn creates a Client that speaks the DAP wire protocol over
+// an already established io.ReadWriteCloser (for example the client end of
+// a net.Pipe returned by dap.NewPipeServer) instead of dialing a TCP
+// address. This is the counterpart test helpers use to drive an in-process
+// server without touching the network stack.
+func NewClientFromConn(conn io.ReadWriteCloser) *Client {
+	return newClient(conn)
+}
@@ -0,0 +1,475 @@
+// Package dap implements a server speaking the Debug Adapter Protocol over
+// a net.Listener or any other io.ReadWriteCloser (see NewPipeServer).
+package dap
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/go-delve/delve/service"
+	"github.com/go-delve/delve/service/debugger"
+	"github.com/go-delve/delve/service/rpc2"
+	"github.com/google/go-dap"
+)
+
+// DAP-specific error ids, surfaced as Body.Error.Id in ErrorResponses.
+const (
+	FailedToLaunch       = 3000
+	FailedToAttach       = 3001
+	FailedToDisconnect   = 3003
+	RequestCancelled     = 3004
+	UnableToGetVariables = 3005
+)
+
+// Server implements a DAP server that serves a single client session,
+// either accepted from config.Listener or, for an embedded session created
+// via NewPipeServer, handed to it directly as an io.ReadWriteCloser.
+type Server struct {
+	config *service.Config
+
+	listener net.Listener
+	conn     io.ReadWriteCloser
+
+	mu sync.Mutex
+
+	sessionKind  sessionKind
+	debugger     *debugger.Debugger
+	remoteClient *rpc2.RPCClient
+
+	requestCancelsMu sync.Mutex
+	requestCancels   map[int]context.CancelFunc
+
+	sendingMu sync.Mutex
+	rw        io.ReadWriteCloser
+
+	stopOnce       sync.Once
+	stopped        chan struct{}
+	disconnectOnce sync.Once
+
+	seq int
+}
+
+// NewServer creates a new DAP Server that serves requests accepted from
+// config.Listener.
+func NewServer(config *service.Config) *Server {
+	return &Server{
+		config:         config,
+		listener:       config.Listener,
+		requestCancels: make(map[int]context.CancelFunc),
+		stopped:        make(chan struct{}),
+	}
+}
+
+// Run starts serving the server's session on its own goroutine: if the
+// server was created via NewPipeServer it serves the pre-established
+// connection directly, otherwise it accepts a single connection off
+// config.Listener, the same way a TCP-backed server always has.
+func (s *Server) Run() {
+	go func() {
+		if s.conn != nil {
+			s.runSession(s.conn)
+			return
+		}
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.stopped:
+			default:
+				log.Printf("Error accepting DAP connection: %v", err)
+			}
+			return
+		}
+		s.runSession(netConn)
+	}()
+}
+
+// Serve starts the DAP wire-protocol loop directly on conn, bypassing the
+// listener-accept step used by Run. It blocks until conn is closed or the
+// client disconnects.
+func (s *Server) Serve(conn io.ReadWriteCloser) {
+	s.runSession(conn)
+}
+
+// Stop closes the server's connection (or listener) and unblocks Run's
+// goroutine.
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+		if s.listener != nil {
+			s.listener.Close()
+		}
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.mu.Lock()
+		rw := s.rw
+		s.mu.Unlock()
+		if rw != nil {
+			rw.Close()
+		}
+	})
+}
+
+// runSession reads and dispatches DAP requests off conn until the
+// connection closes or a request tells it to stop.
+func (s *Server) runSession(conn io.ReadWriteCloser) {
+	s.mu.Lock()
+	s.rw = conn
+	s.mu.Unlock()
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		request, err := dap.ReadProtocolMessage(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("DAP error reading message: %v", err)
+			}
+			return
+		}
+
+		// cancel and disconnect are handled outside the per-request context
+		// machinery: cancel needs to reach into the *other* request's
+		// context, and disconnect tears down the whole session rather than
+		// answering a single request.
+		switch request := request.(type) {
+		case *dap.CancelRequest:
+			s.onCancelRequest(request)
+			continue
+		case *dap.DisconnectRequest:
+			s.onDisconnectRequest(request)
+			return
+		}
+
+		// beginRequest registers seq's cancel func synchronously, in the
+		// read loop, before the handler - including one we're about to
+		// hand off to its own goroutine below - ever runs. That ordering
+		// matters: a "cancel" for this seq is the very next message this
+		// loop reads, and onCancelRequest above looks seq up in the same
+		// map beginRequest writes to, so registration can't be allowed to
+		// race behind it.
+		seq := request.GetSeq()
+		ctx := s.beginRequest(seq)
+
+		if request, ok := request.(*dap.VariablesRequest); ok {
+			// Variable loading can block for a while walking DWARF entries
+			// and reading memory; run it on its own goroutine so the read
+			// loop stays free to pick up a following "cancel" request (or
+			// any other request) instead of queuing behind it.
+			go func() {
+				defer s.endRequest(seq)
+				s.onVariablesRequest(ctx, request)
+			}()
+			continue
+		}
+
+		ok := s.dispatch(request)
+		s.endRequest(seq)
+		if !ok {
+			return
+		}
+	}
+}
+
+// dispatch runs the handler for a request that isn't cancel, disconnect or
+// variables - those are handled directly in runSession, since each needs
+// different treatment of the per-request context. It returns false if the
+// session should end.
+func (s *Server) dispatch(request dap.Message) bool {
+	switch request := request.(type) {
+	case *dap.InitializeRequest:
+		s.onInitializeRequest(request)
+	case *dap.LaunchRequest:
+		s.onLaunchRequest(request)
+	case *dap.AttachRequest:
+		s.onAttachRequest(request)
+	case *dap.SetBreakpointsRequest:
+		s.onSetBreakpointsRequest(request)
+	case *dap.SetExceptionBreakpointsRequest:
+		s.onSetExceptionBreakpointsRequest(request)
+	case *dap.ConfigurationDoneRequest:
+		s.onConfigurationDoneRequest(request)
+	case *dap.ContinueRequest:
+		s.onContinueRequest(request)
+	default:
+		log.Printf("Unable to process %#v", request)
+		return false
+	}
+	return true
+}
+
+func (s *Server) onInitializeRequest(request *dap.InitializeRequest) {
+	response := &dap.InitializeResponse{Response: *newResponse(request.Request)}
+	response.Body.SupportsConfigurationDoneRequest = true
+	response.Body.SupportsConditionalBreakpoints = true
+	// We always advertise the capability; whether a given session actually
+	// terminates its debuggee on disconnect is decided per-session in
+	// onDisconnectRequest, based on how it was established (see
+	// supportsTerminateDebuggee in attach.go).
+	response.Body.SupportTerminateDebuggee = true
+	s.send(response)
+}
+
+func (s *Server) onLaunchRequest(request *dap.LaunchRequest) {
+	program, ok := request.Arguments["program"].(string)
+	if !ok || program == "" {
+		s.sendErrorResponse(request.Request, FailedToLaunch, "Failed to launch", "The program attribute is missing in debug configuration.")
+		return
+	}
+
+	modeArg, hasMode := request.Arguments["mode"]
+	mode := "exec"
+	if hasMode {
+		m, isString := modeArg.(string)
+		if !isString || (m != "exec" && m != "debug" && m != "test") {
+			s.sendErrorResponse(request.Request, FailedToLaunch, "Failed to launch", fmt.Sprintf("Unsupported 'mode' value %q in debug configuration.", modeArg))
+			return
+		}
+		mode = m
+	}
+
+	binary, err := s.buildOrLocateBinary(program, mode, request.Arguments)
+	if err != nil {
+		s.sendErrorResponse(request.Request, FailedToLaunch, "Failed to launch", err.Error())
+		return
+	}
+
+	dbg, err := debugger.New(&debugger.Config{Backend: s.config.Backend}, []string{binary})
+	if err != nil {
+		s.sendErrorResponse(request.Request, FailedToLaunch, "Failed to launch", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.debugger = dbg
+	s.mu.Unlock()
+
+	s.send(&dap.InitializedEvent{Event: *newEvent("initialized")})
+	s.send(&dap.LaunchResponse{Response: *newResponse(request.Request)})
+}
+
+// buildOrLocateBinary resolves the "program" launch attribute into a path
+// to an executable: for "exec" that's just program itself (it must already
+// be a built binary), for "debug"/"test" we build it first.
+func (s *Server) buildOrLocateBinary(program, mode string, args map[string]interface{}) (string, error) {
+	switch mode {
+	case "exec":
+		fi, err := os.Stat(program)
+		if err != nil {
+			return "", err
+		}
+		if fi.IsDir() || fi.Mode()&0111 == 0 {
+			return "", fmt.Errorf("%s is not an executable", program)
+		}
+		return program, nil
+	case "debug", "test":
+		output, _ := args["output"].(string)
+		if output == "" {
+			output = "__debug_bin"
+		}
+		buildArgs := []string{"build"}
+		if mode == "test" {
+			buildArgs = append(buildArgs, "-o", output, "-c", program)
+		} else {
+			buildArgs = append(buildArgs, "-o", output, program)
+		}
+		cmd := exec.Command("go", buildArgs...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("Build error: %s\n%s", err.Error(), string(out))
+		}
+		return output, nil
+	}
+	return "", fmt.Errorf("unsupported mode %q", mode)
+}
+
+func (s *Server) onSetBreakpointsRequest(request *dap.SetBreakpointsRequest) {
+	response := &dap.SetBreakpointsResponse{Response: *newResponse(request.Request)}
+	s.mu.Lock()
+	dbg := s.debugger
+	s.mu.Unlock()
+	if dbg == nil {
+		s.send(response)
+		return
+	}
+	breakpoints := make([]dap.Breakpoint, len(request.Arguments.Breakpoints))
+	for i, want := range request.Arguments.Breakpoints {
+		bp, err := dbg.CreateBreakpoint(request.Arguments.Source.Path, want.Line)
+		breakpoints[i].Line = want.Line
+		breakpoints[i].Verified = err == nil
+		if bp != nil {
+			breakpoints[i].Id = bp.ID
+		}
+	}
+	response.Body.Breakpoints = breakpoints
+	s.send(response)
+}
+
+func (s *Server) onSetExceptionBreakpointsRequest(request *dap.SetExceptionBreakpointsRequest) {
+	s.send(&dap.SetExceptionBreakpointsResponse{Response: *newResponse(request.Request)})
+}
+
+func (s *Server) onConfigurationDoneRequest(request *dap.ConfigurationDoneRequest) {
+	s.mu.Lock()
+	dbg := s.debugger
+	s.mu.Unlock()
+	if dbg != nil {
+		if state, err := dbg.Continue(); err == nil && state.Stopped {
+			s.send(&dap.StoppedEvent{
+				Event: *newEvent("stopped"),
+				Body:  dap.StoppedEventBody{Reason: "breakpoint", ThreadId: 1, AllThreadsStopped: true},
+			})
+		}
+	}
+	s.send(&dap.ConfigurationDoneResponse{Response: *newResponse(request.Request)})
+}
+
+func (s *Server) onContinueRequest(request *dap.ContinueRequest) {
+	s.mu.Lock()
+	dbg := s.debugger
+	s.mu.Unlock()
+
+	s.send(&dap.ContinueResponse{Response: *newResponse(request.Request)})
+
+	if dbg == nil {
+		s.send(&dap.TerminatedEvent{Event: *newEvent("terminated")})
+		return
+	}
+	state, err := dbg.Continue()
+	if err != nil || state.Exited {
+		s.send(&dap.TerminatedEvent{Event: *newEvent("terminated")})
+		return
+	}
+	s.send(&dap.StoppedEvent{
+		Event: *newEvent("stopped"),
+		Body:  dap.StoppedEventBody{Reason: "breakpoint", ThreadId: 1, AllThreadsStopped: true},
+	})
+}
+
+// onVariablesRequest loads the variables for a scope/struct/slice
+// reference. ctx carries the deadline/cancellation set up by beginRequest
+// in the read loop; we only get to act on it here, once LoadVariables
+// returns, not at any finer grain inside the load itself - nothing in
+// this series' debugger/proc layer checkpoints on ctx mid-walk yet, so a
+// load that's already running when it's cancelled still runs to
+// completion before we notice and reply with an error instead.
+func (s *Server) onVariablesRequest(ctx context.Context, request *dap.VariablesRequest) {
+	s.mu.Lock()
+	dbg := s.debugger
+	s.mu.Unlock()
+
+	if dbg == nil {
+		s.send(&dap.VariablesResponse{Response: *newResponse(request.Request)})
+		return
+	}
+
+	vars, err := dbg.LoadVariables(ctx, request.Arguments.VariablesReference)
+	if ctx.Err() != nil {
+		s.sendCancelledErrorResponse(ctx, request.Request)
+		return
+	}
+	if err != nil {
+		s.sendErrorResponse(request.Request, UnableToGetVariables, "Unable to load variables", err.Error())
+		return
+	}
+	response := &dap.VariablesResponse{Response: *newResponse(request.Request)}
+	response.Body.Variables = vars
+	s.send(response)
+}
+
+// onDisconnectRequest tears down the debug session. Whether that means
+// killing the debuggee or merely detaching from it depends on how the
+// session was established: see supportsTerminateDebuggee in attach.go.
+func (s *Server) onDisconnectRequest(request *dap.DisconnectRequest) {
+	s.mu.Lock()
+	kind := s.sessionKind
+	dbg := s.debugger
+	remote := s.remoteClient
+	s.mu.Unlock()
+
+	// kill defaults to true only for a session we launched ourselves - that
+	// is the only case where the debuggee's lifetime is ours to own. An
+	// attached session defaults to detaching and leaving the target
+	// process running, the way `dlv attach` always has; the client can
+	// still opt in to killing it via TerminateDebuggee, gated by
+	// supportsTerminateDebuggee so a remote session (never ours to kill)
+	// can't be talked into it.
+	kill := kind == sessionLaunched
+	if request.Arguments.TerminateDebuggee && s.supportsTerminateDebuggee() {
+		kill = true
+	}
+
+	var err error
+	switch {
+	case kind == sessionRemote && remote != nil:
+		// We are only a client of someone else's headless server: drop the
+		// connection, never kill their debuggee.
+		err = remote.Disconnect(false)
+	case dbg != nil:
+		err = dbg.Detach(kill)
+	}
+	if err != nil {
+		s.sendErrorResponse(request.Request, FailedToDisconnect, "Error disconnecting", err.Error())
+		return
+	}
+
+	s.send(&dap.DisconnectResponse{Response: *newResponse(request.Request)})
+	if s.config.DisconnectChan != nil {
+		s.disconnectOnce.Do(func() { close(s.config.DisconnectChan) })
+	}
+}
+
+// send marshals and writes a single DAP message to the client, guarded by
+// sendingMu so concurrent handlers never interleave writes.
+func (s *Server) send(message dap.Message) {
+	s.mu.Lock()
+	rw := s.rw
+	s.mu.Unlock()
+	if rw == nil {
+		return
+	}
+	s.sendingMu.Lock()
+	defer s.sendingMu.Unlock()
+	if err := dap.WriteProtocolMessage(rw, message); err != nil {
+		log.Printf("DAP error writing message: %v", err)
+	}
+}
+
+func newResponse(request dap.Request) *dap.Response {
+	return &dap.Response{
+		ProtocolMessage: dap.ProtocolMessage{Seq: 0, Type: "response"},
+		Command:         request.Command,
+		RequestSeq:      request.Seq,
+		Success:         true,
+	}
+}
+
+func newEvent(event string) *dap.Event {
+	return &dap.Event{
+		ProtocolMessage: dap.ProtocolMessage{Seq: 0, Type: "event"},
+		Event:           event,
+	}
+}
+
+// sendErrorResponse sends an ErrorResponse for request, with the given DAP
+// error id, short summary and detailed format string.
+func (s *Server) sendErrorResponse(request dap.Request, id int, summary, format string) {
+	er := &dap.ErrorResponse{
+		Response: dap.Response{
+			ProtocolMessage: dap.ProtocolMessage{Seq: 0, Type: "response"},
+			Command:         request.Command,
+			RequestSeq:      request.Seq,
+			Success:         false,
+			Message:         summary,
+		},
+	}
+	er.Body.Error.Id = id
+	er.Body.Error.Format = format
+	s.send(er)
+}
@@ -0,0 +1,27 @@
+package dap
+
+import (
+	"io"
+	"net"
+
+	"github.com/go-delve/delve/service"
+)
+
+// NewPipeServer creates a Server that talks the DAP wire protocol over an
+// in-process net.Pipe instead of a TCP listener. It returns the Server,
+// which is not yet running (call Run to start it), and the client-side end
+// of the pipe, which can be handed directly to daptest.NewClientFromConn or
+// to any other io.ReadWriteCloser-based DAP client.
+//
+// This lets a Go process embed a DAP session without binding a network
+// port: the Delve client and server live in the same binary, connected by
+// nothing more than a net.Pipe, which is also what keeps our tests from
+// having to allocate a real socket per case. Run detects that the server
+// was constructed this way (conn is set) and serves conn directly instead
+// of trying to Accept on a listener.
+func NewPipeServer(config *service.Config) (*Server, io.ReadWriteCloser) {
+	clientConn, serverConn := net.Pipe()
+	server := NewServer(config)
+	server.conn = serverConn
+	return server, clientConn
+}